@@ -0,0 +1,132 @@
+package hydrator
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// cachedField holds everything Hydrate needs to know about a tagged struct
+// field, computed once per (type, tag) pair instead of on every Hydrate
+// call. This avoids re-running NumField, Tag.Get, MethodByName, and
+// pkgpath/name concatenation for every field of every visited struct.
+type cachedField struct {
+	index        int
+	name         string
+	tagValue     string
+	kind         reflect.Kind
+	elemKind     reflect.Kind
+	isSlice      bool
+	isArray      bool
+	isPointer    bool
+	anonymous    bool
+	methodIndex  int // -1 if the tag doesn't name a method on the type
+	idFieldIndex int // -1 if tagValue doesn't name a sibling field on the type
+	finderKey    string
+	omitempty    bool // skip hydration if the field is already non-zero
+	dive         bool // finder path only: tagValue names a sibling slice/array of IDs, call the finder once per ID
+	required     bool // promote a nil/empty result into an error identifying the field path
+}
+
+// fieldCacheKey distinguishes cached fields by both type and the Hydrator's
+// tag name, since two Hydrators may use different tags (via Tag) against the
+// same type.
+type fieldCacheKey struct {
+	t   reflect.Type
+	tag string
+}
+
+var fieldCache sync.Map // map[fieldCacheKey][]cachedField
+
+// cachedFields returns the cachedField list for t under tag, building and
+// storing it on first use.
+func cachedFields(t reflect.Type, tag string) []cachedField {
+	key := fieldCacheKey{t: t, tag: tag}
+	if v, ok := fieldCache.Load(key); ok {
+		return v.([]cachedField)
+	}
+
+	fields := buildCachedFields(t, tag)
+	actual, _ := fieldCache.LoadOrStore(key, fields)
+	return actual.([]cachedField)
+}
+
+// buildCachedFields walks t (a struct or pointer-to-struct type) once,
+// recording the tagged fields in declaration order.
+func buildCachedFields(t reflect.Type, tag string) []cachedField {
+	structType := t
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make([]cachedField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		sf := structType.Field(i)
+
+		rawTag := sf.Tag.Get(tag)
+		if rawTag == "" || rawTag == "-" {
+			continue
+		}
+		name, flags := parseTag(rawTag)
+
+		cf := cachedField{
+			index:        i,
+			name:         sf.Name,
+			tagValue:     name,
+			kind:         sf.Type.Kind(),
+			anonymous:    sf.Anonymous,
+			methodIndex:  -1,
+			idFieldIndex: -1,
+			omitempty:    flags["omitempty"],
+			dive:         flags["dive"],
+			required:     flags["required"],
+		}
+
+		switch cf.kind {
+		case reflect.Ptr:
+			cf.isPointer = true
+		case reflect.Slice:
+			cf.isSlice = true
+		case reflect.Array:
+			cf.isArray = true
+		}
+		if cf.isPointer || cf.isSlice || cf.isArray {
+			elemType := sf.Type.Elem()
+			cf.elemKind = elemType.Kind()
+			// For a slice/array of pointers ([]*T), Elem() only unwraps the
+			// slice/array and leaves a pointer type (*T), whose PkgPath/Name
+			// are both empty; unwrap one more level to key on T itself.
+			if (cf.isSlice || cf.isArray) && elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+			cf.finderKey = elemType.PkgPath() + elemType.Name()
+		}
+
+		if m, ok := t.MethodByName(name); ok {
+			cf.methodIndex = m.Index
+		} else if idsf, ok := structType.FieldByName(name); ok && len(idsf.Index) == 1 {
+			cf.idFieldIndex = idsf.Index[0]
+		}
+
+		fields = append(fields, cf)
+	}
+
+	return fields
+}
+
+// parseTag splits a struct tag value on "," into the leading method/field
+// name (preserving the original, option-free tag grammar) and a set of
+// trailing option keywords, e.g. "GetC,omitempty,dive,required". Unknown
+// keywords are ignored, matching the forgiving style of encoding/json's tag
+// options.
+func parseTag(raw string) (name string, flags map[string]bool) {
+	parts := strings.Split(raw, ",")
+	flags = make(map[string]bool, len(parts)-1)
+	for _, opt := range parts[1:] {
+		flags[strings.TrimSpace(opt)] = true
+	}
+	return strings.TrimSpace(parts[0]), flags
+}
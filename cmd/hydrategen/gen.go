@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// writeHeader emits the generated file's package clause and imports. fmt is
+// only imported when usesFmt is true, since a package whose generated
+// methods never reference fmt (e.g. dive-only fields with no required tag)
+// would otherwise fail to build with "fmt" imported and not used.
+func writeHeader(buf *bytes.Buffer, pkgName string, usesFmt bool) {
+	fmt.Fprintf(buf, "// Code generated by hydrategen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", pkgName)
+	fmt.Fprintf(buf, "import (\n")
+	fmt.Fprintf(buf, "\t\"context\"\n")
+	if usesFmt {
+		fmt.Fprintf(buf, "\t\"fmt\"\n")
+	}
+	fmt.Fprintf(buf, "\t\"sync\"\n\n")
+	fmt.Fprintf(buf, "\t\"github.com/hodgesds/hydrator\"\n")
+	fmt.Fprintf(buf, ")\n\n")
+}
+
+// writeHydrateWith emits a HydrateWith method for s, satisfying
+// hydrator.Hydratable: it dispatches each tagged field with typed calls
+// instead of reflection, bounds its own fan-out with h.Acquire/h.Release,
+// and recurses into child fields via h.Hydrate (which prefers a child's own
+// generated HydrateWith when present, falling back to reflection when it
+// isn't).
+func writeHydrateWith(buf *bytes.Buffer, s structInfo) {
+	recv := strings.ToLower(s.Name[:1])
+
+	fmt.Fprintf(buf, "func (%s *%s) HydrateWith(ctx context.Context, h *hydrator.Hydrator) error {\n", recv, s.Name)
+	fmt.Fprintf(buf, "\tvar err error\n")
+	fmt.Fprintf(buf, "\tvar mu sync.Mutex\n")
+	fmt.Fprintf(buf, "\tvar wg sync.WaitGroup\n\n")
+
+	for _, f := range s.Fields {
+		writeFieldDispatch(buf, recv, f)
+	}
+
+	fmt.Fprintf(buf, "\twg.Wait()\n")
+	fmt.Fprintf(buf, "\tif err != nil {\n\t\treturn err\n\t}\n\n")
+
+	for _, f := range s.Fields {
+		if !f.Required {
+			continue
+		}
+		cond := fmt.Sprintf("%s.%s == nil", recv, f.Name)
+		fmt.Fprintf(buf, "\tif %s {\n", cond)
+		fmt.Fprintf(buf, "\t\treturn fmt.Errorf(\"hydrator: required field %s was not hydrated\")\n", f.Name)
+		fmt.Fprintf(buf, "\t}\n")
+	}
+	if len(s.Fields) > 0 {
+		fmt.Fprintf(buf, "\n")
+	}
+
+	for _, f := range s.Fields {
+		if f.IsSlice {
+			fmt.Fprintf(buf, "\tfor _, v := range %s.%s {\n", recv, f.Name)
+			fmt.Fprintf(buf, "\t\tif v == nil {\n\t\t\tcontinue\n\t\t}\n")
+			fmt.Fprintf(buf, "\t\tif err := h.Hydrate(ctx, v); err != nil {\n\t\t\treturn err\n\t\t}\n")
+			fmt.Fprintf(buf, "\t}\n")
+			continue
+		}
+		fmt.Fprintf(buf, "\tif %s.%s != nil {\n", recv, f.Name)
+		fmt.Fprintf(buf, "\t\tif err := h.Hydrate(ctx, %s.%s); err != nil {\n\t\t\treturn err\n\t\t}\n", recv, f.Name)
+		fmt.Fprintf(buf, "\t}\n")
+	}
+
+	fmt.Fprintf(buf, "\treturn nil\n")
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+// writeFieldDispatch emits the goroutine that resolves a single tagged
+// field: a direct method call when the tag names one, otherwise a lookup
+// through the Hydrator's Finder/BatchFinder registry keyed on the field's
+// target type.
+func writeFieldDispatch(buf *bytes.Buffer, recv string, f taggedField) {
+	fmt.Fprintf(buf, "\twg.Add(1)\n")
+	fmt.Fprintf(buf, "\tgo func() {\n")
+	fmt.Fprintf(buf, "\t\tdefer wg.Done()\n")
+	if f.Omitempty {
+		fmt.Fprintf(buf, "\t\tif %s.%s != nil {\n\t\t\treturn\n\t\t}\n", recv, f.Name)
+	}
+	fmt.Fprintf(buf, "\t\th.Acquire()\n")
+	fmt.Fprintf(buf, "\t\tdefer h.Release()\n\n")
+
+	switch {
+	case f.MethodName != "":
+		fmt.Fprintf(buf, "\t\tv, ferr := %s.%s(ctx, %s)\n", recv, f.MethodName, recv)
+	case f.Dive:
+		writeDiveCall(buf, recv, f)
+	default:
+		writeSingleFinderCall(buf, recv, f)
+	}
+
+	fmt.Fprintf(buf, "\t\tmu.Lock()\n")
+	fmt.Fprintf(buf, "\t\tdefer mu.Unlock()\n")
+	fmt.Fprintf(buf, "\t\tif ferr != nil {\n")
+	fmt.Fprintf(buf, "\t\t\tif err == nil {\n\t\t\t\terr = ferr\n\t\t\t}\n")
+	fmt.Fprintf(buf, "\t\t\treturn\n\t\t}\n")
+
+	if f.Dive {
+		fmt.Fprintf(buf, "\t\t%s.%s = out\n", recv, f.Name)
+	} else {
+		fmt.Fprintf(buf, "\t\tval, ok := v.(%s)\n", f.TypeString)
+		fmt.Fprintf(buf, "\t\tif !ok {\n")
+		fmt.Fprintf(buf, "\t\t\tif err == nil {\n")
+		fmt.Fprintf(buf, "\t\t\t\terr = fmt.Errorf(\"Attempted to hydrate %%T.%s with a %%T\", %s, v)\n", f.Name, recv)
+		fmt.Fprintf(buf, "\t\t\t}\n\t\t\treturn\n\t\t}\n")
+		fmt.Fprintf(buf, "\t\t%s.%s = val\n", recv, f.Name)
+	}
+
+	fmt.Fprintf(buf, "\t}()\n\n")
+}
+
+// writeSingleFinderCall emits the body that resolves one field via the
+// Hydrator's BatchFinder (preferred) or Finder registry, keyed on the
+// field's sibling ID.
+func writeSingleFinderCall(buf *bytes.Buffer, recv string, f taggedField) {
+	fmt.Fprintf(buf, "\t\tvar v interface{}\n")
+	fmt.Fprintf(buf, "\t\tvar ferr error\n")
+	fmt.Fprintf(buf, "\t\tif bf, ok := h.LookupBatchFinder(%q); ok {\n", f.FinderKey)
+	fmt.Fprintf(buf, "\t\t\tvar res []interface{}\n")
+	fmt.Fprintf(buf, "\t\t\tres, ferr = bf(ctx, []interface{}{%s.%s})\n", recv, f.IDFieldName)
+	fmt.Fprintf(buf, "\t\t\tif ferr == nil && len(res) > 0 {\n\t\t\t\tv = res[0]\n\t\t\t}\n")
+	fmt.Fprintf(buf, "\t\t} else if fn, ok := h.LookupFinder(%q); ok {\n", f.FinderKey)
+	fmt.Fprintf(buf, "\t\t\tv, ferr = fn(ctx, %s.%s)\n", recv, f.IDFieldName)
+	fmt.Fprintf(buf, "\t\t} else {\n\t\t\treturn\n\t\t}\n")
+}
+
+// writeDiveCall emits the body that resolves a slice field by calling the
+// Finder once per ID in the sibling ID slice named by the tag (or the
+// BatchFinder once with all of those IDs), rather than treating the whole
+// slice as a single ID.
+func writeDiveCall(buf *bytes.Buffer, recv string, f taggedField) {
+	fmt.Fprintf(buf, "\t\tids := %s.%s\n", recv, f.IDFieldName)
+	fmt.Fprintf(buf, "\t\tvals := make([]interface{}, len(ids))\n")
+	fmt.Fprintf(buf, "\t\tvar ferr error\n")
+	fmt.Fprintf(buf, "\t\tif bf, ok := h.LookupBatchFinder(%q); ok {\n", f.FinderKey)
+	fmt.Fprintf(buf, "\t\t\tidsIface := make([]interface{}, len(ids))\n")
+	fmt.Fprintf(buf, "\t\t\tfor i, id := range ids {\n\t\t\t\tidsIface[i] = id\n\t\t\t}\n")
+	fmt.Fprintf(buf, "\t\t\tvals, ferr = bf(ctx, idsIface)\n")
+	fmt.Fprintf(buf, "\t\t} else if fn, ok := h.LookupFinder(%q); ok {\n", f.FinderKey)
+	fmt.Fprintf(buf, "\t\t\tvar dwg sync.WaitGroup\n")
+	fmt.Fprintf(buf, "\t\t\tfor i, id := range ids {\n")
+	fmt.Fprintf(buf, "\t\t\t\tdwg.Add(1)\n")
+	fmt.Fprintf(buf, "\t\t\t\tgo func(i int, id interface{}) {\n")
+	fmt.Fprintf(buf, "\t\t\t\t\tdefer dwg.Done()\n")
+	fmt.Fprintf(buf, "\t\t\t\t\tvals[i], _ = fn(ctx, id)\n")
+	fmt.Fprintf(buf, "\t\t\t\t}(i, id)\n")
+	fmt.Fprintf(buf, "\t\t\t}\n")
+	fmt.Fprintf(buf, "\t\t\tdwg.Wait()\n")
+	fmt.Fprintf(buf, "\t\t} else {\n\t\t\treturn\n\t\t}\n")
+	fmt.Fprintf(buf, "\t\tout := make(%s, len(vals))\n", f.TypeString)
+	fmt.Fprintf(buf, "\t\tfor i, v := range vals {\n")
+	fmt.Fprintf(buf, "\t\t\tif c, ok := v.(%s); ok {\n\t\t\t\tout[i] = c\n\t\t\t}\n", "*"+f.ElemType)
+	fmt.Fprintf(buf, "\t\t}\n")
+}
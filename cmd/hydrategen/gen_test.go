@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadAndGenerate runs hydrategen's own load+generate pipeline against dir
+// (relative to this package's directory) and returns the path it wrote, with
+// cleanup registered so the generated file doesn't linger after the test.
+func loadAndGenerate(t *testing.T, dir string) string {
+	t.Helper()
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedTypesInfo,
+	}, dir)
+	if err != nil {
+		t.Fatalf("loading %s: %v", dir, err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("expected 1 package for %s, got %d", dir, len(pkgs))
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		t.Fatalf("%s: %v", dir, pkg.Errors[0])
+	}
+
+	const output = "zz_hydrate_gen.go"
+	if err := generatePackage(pkg, defaultTag, output); err != nil {
+		t.Fatalf("generatePackage(%s): %v", dir, err)
+	}
+
+	outPath := filepath.Join(filepath.Dir(pkg.GoFiles[0]), output)
+	t.Cleanup(func() { os.Remove(outPath) })
+	return outPath
+}
+
+// Test_hydrategen_DiveOnlyField_builds reproduces chunk0-6's fmt-import bug:
+// a struct whose only tagged field uses dive with no required tag must not
+// generate a file that unconditionally imports fmt without using it.
+func Test_hydrategen_DiveOnlyField_builds(t *testing.T) {
+	loadAndGenerate(t, "./testdata/divefixture")
+
+	out, err := exec.Command("go", "build", "github.com/hodgesds/hydrator/cmd/hydrategen/testdata/divefixture").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build divefixture: %v\n%s", err, out)
+	}
+}
+
+// Test_hydrategen_MainPackage_FinderKey reproduces chunk0-6's FinderKey bug:
+// for a type in package main, the generated LookupFinder/LookupBatchFinder
+// call must key on "main", matching what reflect.Type.PkgPath() reports at
+// runtime, not go/types' real build path for the package.
+func Test_hydrategen_MainPackage_FinderKey(t *testing.T) {
+	outPath := loadAndGenerate(t, "./testdata/mainfixture")
+
+	src, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("reading generated file: %v", err)
+	}
+	if !strings.Contains(string(src), `"mainB"`) {
+		t.Fatalf("expected generated code to key B's Finder lookup on %q, got:\n%s", "mainB", src)
+	}
+
+	bin := filepath.Join(t.TempDir(), "mainfixture")
+	out, buildErr := exec.Command("go", "build", "-o", bin, "github.com/hodgesds/hydrator/cmd/hydrategen/testdata/mainfixture").CombinedOutput()
+	if buildErr != nil {
+		t.Fatalf("go build mainfixture: %v\n%s", buildErr, out)
+	}
+}
+
+// Test_hydrategen_CycleProtection reproduces chunk0-6's unbounded-recursion
+// bug: a generated HydrateWith for a self-referencing type must still
+// return a *hydrator.CycleDetectedError instead of recursing forever. The
+// actual assertion lives in testdata/cyclefixture's own test, run here as a
+// subprocess with a timeout so a regression shows up as a bounded failure
+// instead of crashing this test binary with a stack overflow.
+func Test_hydrategen_CycleProtection(t *testing.T) {
+	loadAndGenerate(t, "./testdata/cyclefixture")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "test", "github.com/hodgesds/hydrator/cmd/hydrategen/testdata/cyclefixture")
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatalf("cyclefixture test did not return within the timeout (likely unbounded recursion):\n%s", out)
+	}
+	if err != nil {
+		t.Fatalf("go test cyclefixture: %v\n%s", err, out)
+	}
+}
+
+// Test_finderPkgPath pins finderPkgPath's behavior directly, without the
+// cost of a full packages.Load + go build round trip.
+func Test_finderPkgPath(t *testing.T) {
+	if got := finderPkgPath(types.NewPackage("example.com/cmd/foo", "main")); got != "main" {
+		t.Errorf("package main: expected %q, got %q", "main", got)
+	}
+	if got := finderPkgPath(types.NewPackage("example.com/lib", "lib")); got != "example.com/lib" {
+		t.Errorf("non-main package: expected %q, got %q", "example.com/lib", got)
+	}
+}
@@ -0,0 +1,289 @@
+// Command hydrategen generates typed HydrateWith methods for structs with
+// `hydrate:"..."` tags, so that Hydrator.Hydrate can dispatch to them
+// directly instead of walking the struct with reflection. It mirrors the
+// gqlgen approach of generating strongly typed resolver dispatch ahead of
+// time rather than paying reflection cost on every request.
+//
+// Usage:
+//
+//	hydrategen [-output file] [package ...]
+//
+// For every struct in the given packages (the current directory's package
+// if none are given) that has at least one supported `hydrate` tag,
+// hydrategen emits a HydrateWith method into <output> (zz_hydrate_gen.go by
+// default) in that struct's own package.
+//
+// hydrategen only understands tags naming a resolver method or a sibling ID
+// field of pointer-to-struct or slice-of-pointer-to-struct fields; anything
+// else (arrays, anonymous fields, tags it can't resolve at all) is left out
+// of the generated method entirely rather than falling back field-by-field,
+// so a struct with a mix of supported and unsupported tags should not be
+// generated for until the unsupported fields are reworked or dropped.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const defaultTag = "hydrate"
+
+func main() {
+	output := flag.String("output", "zz_hydrate_gen.go", "name of the generated file, written into each package's directory")
+	tag := flag.String("tag", defaultTag, "struct tag to scan for hydrate directives")
+	flag.Parse()
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedTypesInfo,
+	}, patterns...)
+	if err != nil {
+		log.Fatalf("hydrategen: loading packages: %v", err)
+	}
+
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			log.Fatalf("hydrategen: %s: %v", pkg.PkgPath, pkg.Errors[0])
+		}
+		if err := generatePackage(pkg, *tag, *output); err != nil {
+			log.Fatalf("hydrategen: %s: %v", pkg.PkgPath, err)
+		}
+	}
+}
+
+// generatePackage scans pkg for taggable structs and, if it finds any,
+// writes the generated file into pkg's directory.
+func generatePackage(pkg *packages.Package, tag, output string) error {
+	structs := findStructs(pkg, tag)
+	if len(structs) == 0 {
+		return nil
+	}
+
+	usesFmt := false
+	for _, s := range structs {
+		if structNeedsFmt(s) {
+			usesFmt = true
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, pkg.Name, usesFmt)
+	for _, s := range structs {
+		writeHydrateWith(&buf, s)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		// Write the unformatted source too, so a bug in hydrategen is
+		// debuggable instead of silently swallowed.
+		src = buf.Bytes()
+		log.Printf("hydrategen: %s: generated source did not gofmt: %v", pkg.PkgPath, err)
+	}
+
+	dir := filepath.Dir(pkg.GoFiles[0])
+	return os.WriteFile(filepath.Join(dir, output), src, 0o644)
+}
+
+// structNeedsFmt reports whether s's generated HydrateWith method will
+// reference the fmt package: either a required-field check (writeHydrateWith)
+// or a non-dive field's type-assert error (writeFieldDispatch). A struct
+// whose only tagged fields use dive with no required tag emits neither, and
+// importing fmt unconditionally for it fails the build with "imported and
+// not used".
+func structNeedsFmt(s structInfo) bool {
+	for _, f := range s.Fields {
+		if f.Required || !f.Dive {
+			return true
+		}
+	}
+	return false
+}
+
+// structInfo is everything needed to emit one type's HydrateWith method.
+type structInfo struct {
+	Name   string
+	Fields []taggedField
+}
+
+// taggedField describes one `hydrate`-tagged field that hydrategen knows how
+// to dispatch without reflection. Fields it doesn't understand (anonymous
+// fields, arrays, anything whose tag names neither a method nor a sibling
+// ID field) are left out of the generated method; see the package doc.
+type taggedField struct {
+	Name        string
+	TypeString  string // e.g. "*C" or "[]*D", for the type assertion on the resolver's result
+	ElemType    string // C's name, for recursing via h.Hydrate
+	IsSlice     bool
+	MethodName  string // "" if this field resolves via a Finder/BatchFinder instead
+	IDFieldName string // sibling field holding the ID(s), when MethodName == ""
+	FinderKey   string // PkgPath+Name of the target type, for LookupFinder/LookupBatchFinder
+	Omitempty   bool
+	Dive        bool
+	Required    bool
+}
+
+// findStructs walks every named struct type declared in pkg and collects the
+// ones with at least one field hydrategen can generate typed dispatch for.
+func findStructs(pkg *packages.Package, tag string) []structInfo {
+	var out []structInfo
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		st, ok := named.Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+
+		info := structInfo{Name: named.Obj().Name()}
+		for i := 0; i < st.NumFields(); i++ {
+			f, ok := buildTaggedField(named, st, i, tag)
+			if !ok {
+				continue
+			}
+			info.Fields = append(info.Fields, f)
+		}
+		if len(info.Fields) > 0 {
+			out = append(out, info)
+		}
+	}
+	return out
+}
+
+// buildTaggedField inspects field i of st (the underlying struct of named)
+// and, if it's a field hydrategen supports, returns its taggedField.
+func buildTaggedField(named *types.Named, st *types.Struct, i int, tag string) (taggedField, bool) {
+	sf := st.Field(i)
+	if sf.Embedded() {
+		return taggedField{}, false
+	}
+
+	rawTag := reflect.StructTag(st.Tag(i)).Get(tag)
+	if rawTag == "" || rawTag == "-" {
+		return taggedField{}, false
+	}
+	name, flags := parseTag(rawTag)
+
+	fieldType := sf.Type()
+	f := taggedField{
+		Name:      sf.Name(),
+		Omitempty: flags["omitempty"],
+		Dive:      flags["dive"],
+		Required:  flags["required"],
+	}
+
+	switch t := fieldType.(type) {
+	case *types.Pointer:
+		elemNamed, ok := t.Elem().(*types.Named)
+		if !ok {
+			return taggedField{}, false
+		}
+		f.TypeString = "*" + elemNamed.Obj().Name()
+		f.ElemType = elemNamed.Obj().Name()
+		f.FinderKey = finderPkgPath(elemNamed.Obj().Pkg()) + elemNamed.Obj().Name()
+	case *types.Slice:
+		ptr, ok := t.Elem().(*types.Pointer)
+		if !ok {
+			return taggedField{}, false
+		}
+		elemNamed, ok := ptr.Elem().(*types.Named)
+		if !ok {
+			return taggedField{}, false
+		}
+		f.IsSlice = true
+		f.TypeString = "[]*" + elemNamed.Obj().Name()
+		f.ElemType = elemNamed.Obj().Name()
+		f.FinderKey = finderPkgPath(elemNamed.Obj().Pkg()) + elemNamed.Obj().Name()
+	default:
+		// Arrays and anything else are left out of the generated method.
+		return taggedField{}, false
+	}
+
+	if hasHydrateMethod(named, name) {
+		f.MethodName = name
+		// dive only applies to Finder-backed fields, as on the reflective
+		// path: the method already builds the whole slice.
+		f.Dive = false
+		return f, true
+	}
+	if idx := indexOfField(st, name); idx >= 0 {
+		f.IDFieldName = name
+		return f, true
+	}
+	return taggedField{}, false
+}
+
+// finderPkgPath returns the package path to key a Finder/BatchFinder
+// registry entry on, matching what reflect.Type.PkgPath() reports at
+// runtime for the same type. go/types' Package.Path() returns a main
+// package's real build path (e.g. "github.com/foo/cmd/bar"), but
+// reflect.Type.PkgPath() always reports the literal "main" for types
+// declared in package main regardless of that path. Using Path()
+// unconditionally would make generated code's LookupFinder/LookupBatchFinder
+// calls key on a string Hydrator.Finder/BatchFinder never registered under,
+// silently missing every Finder-backed field on a package main type.
+func finderPkgPath(pkg *types.Package) string {
+	if pkg.Name() == "main" {
+		return "main"
+	}
+	return pkg.Path()
+}
+
+// hasHydrateMethod reports whether named has a method called methodName; it
+// doesn't check the signature beyond that, so a method with the wrong
+// signature makes the generated call fail to compile (the reflective path
+// discovers the same way via MethodByName and returns an error when the
+// method's argument or result count is wrong).
+func hasHydrateMethod(named *types.Named, methodName string) bool {
+	for i := 0; i < named.NumMethods(); i++ {
+		if named.Method(i).Name() == methodName {
+			return true
+		}
+	}
+	ptr := types.NewPointer(named)
+	mset := types.NewMethodSet(ptr)
+	return mset.Lookup(nil, methodName) != nil
+}
+
+// indexOfField returns the index of the struct field named name, or -1.
+func indexOfField(st *types.Struct, name string) int {
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTag mirrors hydrator's own internal tag grammar: a leading
+// method/field name followed by comma-separated option keywords, e.g.
+// "GetC,omitempty,dive,required". Kept as a small local copy rather than an
+// import since it's unexported in the hydrator package.
+func parseTag(raw string) (name string, flags map[string]bool) {
+	parts := strings.Split(raw, ",")
+	flags = make(map[string]bool, len(parts)-1)
+	for _, opt := range parts[1:] {
+		flags[strings.TrimSpace(opt)] = true
+	}
+	return strings.TrimSpace(parts[0]), flags
+}
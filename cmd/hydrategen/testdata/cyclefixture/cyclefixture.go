@@ -0,0 +1,11 @@
+// Package cyclefixture is a hydrategen fixture with a self-referencing
+// type, used to test that a generated HydrateWith method still enforces
+// cycle detection instead of recursing forever.
+package cyclefixture
+
+// Node references itself via ParentID, resolved through a Finder.
+type Node struct {
+	ID       int
+	ParentID int
+	Parent   *Node `hydrate:"ParentID"`
+}
@@ -0,0 +1,29 @@
+package cyclefixture
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hodgesds/hydrator"
+)
+
+// Test_cyclefixture_CycleError hydrates a Node whose Finder always resolves
+// back to the same instance, forming a back-reference. Run by the
+// hydrategen end-to-end test (see cmd/hydrategen/gen_test.go) as a
+// subprocess, after (re)generating this package's HydrateWith, so an
+// unbounded-recursion regression shows up as a subprocess crash/timeout
+// rather than taking down the whole test binary.
+func Test_cyclefixture_CycleError(t *testing.T) {
+	ctx := context.Background()
+	h := hydrator.NewHydrator(hydrator.OnCycle(hydrator.CycleError))
+
+	n := &Node{ID: 1, ParentID: 1}
+	h.Finder(Node{}, func(ctx context.Context, id interface{}) (interface{}, error) {
+		return n, nil
+	})
+
+	err := h.Hydrate(ctx, n)
+	if _, ok := err.(*hydrator.CycleDetectedError); !ok {
+		t.Fatalf("expected *hydrator.CycleDetectedError, got %T: %v", err, err)
+	}
+}
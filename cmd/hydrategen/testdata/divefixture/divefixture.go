@@ -0,0 +1,16 @@
+// Package divefixture is a hydrategen fixture whose only tagged field uses
+// the dive option with no required tag, reproducing the case where the
+// generated HydrateWith method never references fmt.
+package divefixture
+
+// Child is the dive target.
+type Child struct {
+	ID int
+}
+
+// Parent dives over ChildIDs, calling the Child Finder once per ID.
+type Parent struct {
+	ID       int
+	ChildIDs []int
+	Children []*Child `hydrate:"ChildIDs,dive"`
+}
@@ -0,0 +1,21 @@
+// Command mainfixture is a hydrategen fixture that reproduces the
+// FinderKey mismatch for types declared in package main: reflect.Type.PkgPath()
+// always reports "main" for such types at runtime, regardless of the
+// package's real build path.
+package main
+
+// B is resolved via a Finder, not a method, so hydrategen must key its
+// generated LookupFinder/LookupBatchFinder call the same way
+// Hydrator.Finder/BatchFinder registers it at runtime.
+type B struct {
+	ID int
+}
+
+// A has a Finder-backed field.
+type A struct {
+	ID  int
+	BID int
+	B   *B `hydrate:"BID"`
+}
+
+func main() {}
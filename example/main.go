@@ -17,7 +17,7 @@ type A struct {
 }
 
 // GetC is a method to get C
-func (a *A) GetC(x interface{}) (interface{}, error) {
+func (a *A) GetC(ctx context.Context, x interface{}) (interface{}, error) {
 	println("calling GetC")
 	return &C{ID: 3}, nil
 }
@@ -33,7 +33,7 @@ type C struct {
 	D  *D `hydrate:"GetD"`
 }
 
-func (c *C) GetD(x interface{}) (interface{}, error) {
+func (c *C) GetD(ctx context.Context, x interface{}) (interface{}, error) {
 	println("calling GetD")
 	return &D{ID: 4}, nil
 }
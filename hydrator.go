@@ -1,16 +1,28 @@
 package hydrator
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // ErrInvalidObject is returned when a Hydrator is unable to hydrate an object.
 var ErrInvalidObject = fmt.Errorf("Invalid object")
 
+// defaultBatchWindow is the BatchWindow used when none is configured. See
+// BatchWindow for why it's non-zero.
+const defaultBatchWindow = time.Millisecond
+
 // Finder is used to find an instance.
-type Finder func(interface{}) (interface{}, error)
+type Finder func(ctx context.Context, id interface{}) (interface{}, error)
+
+// BatchFinder is used to find a batch of instances at once. It mirrors
+// Finder but is invoked with the deduped set of IDs requested for a type
+// within one batch window of a Hydrate call, DataLoader-style. The returned slice must
+// be the same length as ids, with results in the same order.
+type BatchFinder func(ctx context.Context, ids []interface{}) ([]interface{}, error)
 
 // Opt is an option for configuring a Hydrator.
 type Opt func(*Hydrator)
@@ -32,19 +44,93 @@ func Tag(tag string) Opt {
 	}
 }
 
+// BatchWindow sets how long the loader waits, after the most recent request
+// for a type during a Hydrate call, before invoking that type's
+// BatchFinder. Each additional request for the same type that arrives within
+// the window restarts it and is coalesced into the same call. The default, defaultBatchWindow,
+// is small but non-zero so that the concurrent goroutines spawned for a
+// single wave of sibling fields (or slice elements) reliably have time to
+// enqueue their requests before the batch fires.
+func BatchWindow(d time.Duration) Opt {
+	return func(h *Hydrator) {
+		h.batchWindow = d
+	}
+}
+
+// CycleBehavior controls what a Hydrator does when it encounters a
+// back-reference to an object it has already visited within the same
+// Hydrate call.
+type CycleBehavior int
+
+const (
+	// CycleSkip stops recursing into an already-visited object but leaves
+	// the reference that was set on the field in place. This is the
+	// default.
+	CycleSkip CycleBehavior = iota
+	// CycleError returns a *CycleDetectedError identifying the field path
+	// where the back-reference was found instead of silently skipping it.
+	CycleError
+)
+
+// OnCycle sets how a Hydrator behaves when it detects a back-reference
+// while walking an object graph. The default is CycleSkip.
+func OnCycle(b CycleBehavior) Opt {
+	return func(h *Hydrator) {
+		h.cycleBehavior = b
+	}
+}
+
+// MaxDepth caps how deep a single Hydrate call will recurse, as a
+// defense-in-depth measure independent of cycle detection. A value <= 0
+// (the default) leaves depth unbounded. Exceeding the cap returns a
+// *MaxDepthError identifying the field path where the limit tripped (for a
+// Hydratable object, its type instead; see Hydratable).
+func MaxDepth(n int) Opt {
+	return func(h *Hydrator) {
+		h.maxDepth = n
+	}
+}
+
+// CycleDetectedError is returned when OnCycle(CycleError) is set and
+// Hydrate encounters a back-reference to an object it has already visited.
+type CycleDetectedError struct {
+	Path string
+}
+
+func (e *CycleDetectedError) Error() string {
+	return fmt.Sprintf("hydrator: cycle detected at %s", e.Path)
+}
+
+// MaxDepthError is returned when a Hydrate call recurses past the
+// MaxDepth cap.
+type MaxDepthError struct {
+	Path  string
+	Depth int
+}
+
+func (e *MaxDepthError) Error() string {
+	return fmt.Sprintf("hydrator: max depth %d exceeded at %s", e.Depth, e.Path)
+}
+
 // Hydrator is used to hydrate objects.
 type Hydrator struct {
 	sync.RWMutex
-	tag      string
-	finders  map[string]Finder
-	flowChan chan struct{}
+	tag           string
+	finders       map[string]Finder
+	batchFinders  map[string]BatchFinder
+	batchWindow   time.Duration
+	flowChan      chan struct{}
+	maxDepth      int
+	cycleBehavior CycleBehavior
 }
 
 // NewHydrator returns a new Hydrator, if Concurrency is not set it defaults to 10.
 func NewHydrator(opts ...Opt) *Hydrator {
 	h := &Hydrator{
-		tag:     "hydrate",
-		finders: map[string]Finder{},
+		tag:          "hydrate",
+		finders:      map[string]Finder{},
+		batchFinders: map[string]BatchFinder{},
+		batchWindow:  defaultBatchWindow,
 	}
 
 	for _, opt := range opts {
@@ -57,6 +143,68 @@ func NewHydrator(opts ...Opt) *Hydrator {
 	return h
 }
 
+// Acquire blocks until a concurrency slot is available, mirroring the
+// internal gate hydrate uses before calling a resolver method or Finder.
+// It is exported for generated HydrateWith methods (see cmd/hydrategen) so
+// they can bound their own fan-out the same way the reflective path does.
+func (h *Hydrator) Acquire() {
+	h.flowChan <- struct{}{}
+}
+
+// Release returns a concurrency slot acquired with Acquire.
+func (h *Hydrator) Release() {
+	<-h.flowChan
+}
+
+// Hydratable is implemented by types with a generated HydrateWith method
+// (see cmd/hydrategen). When obj implements Hydratable, Hydrate calls it
+// directly instead of walking obj with reflection. Generated code dispatches
+// straight to typed resolver calls and recurses into child types via their
+// own HydrateWith, trading the reflective path's DataLoader coalescing and
+// WithSelection/Without support for eliminating reflection from the hot
+// path entirely. Cycle detection and MaxDepth are still enforced: Hydrate
+// threads a per-call guard through ctx (every generated recursive call goes
+// back through h.Hydrate(ctx, child), so the guard rides along unmodified),
+// tracking visited pointers and depth the same way the reflective path's
+// loader does. Without that, a self-referencing Hydratable graph would
+// recurse forever and crash with a stack overflow instead of returning a
+// *CycleDetectedError or *MaxDepthError. On this path the error's Path holds
+// the Go type of the object where the guard tripped (e.g. "*pkg.Node"), not
+// a dotted field path.
+type Hydratable interface {
+	HydrateWith(ctx context.Context, h *Hydrator) error
+}
+
+// hydratableGuardKey is the context key under which Hydrate stores the
+// *hydratableGuard for a top-level Hydratable call, so the same guard is
+// visible to every recursive h.Hydrate(ctx, child) call reachable through
+// generated HydrateWith methods.
+type hydratableGuardKey struct{}
+
+// hydratableDepthKey is the context key under which Hydrate stores the
+// current recursion depth for a Hydratable call chain.
+type hydratableDepthKey struct{}
+
+// hydratableGuard is the Hydratable fast path's equivalent of loader's
+// visited set: it's created once per top-level Hydrate call and shared, via
+// ctx, with every recursive call in that object graph.
+type hydratableGuard struct {
+	mu      sync.Mutex
+	visited map[uintptr]struct{}
+}
+
+// visit records ptr as visited, reporting whether it was newly recorded;
+// false means ptr was already visited, signalling a cycle.
+func (g *hydratableGuard) visit(ptr uintptr) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.visited[ptr]; ok {
+		return false
+	}
+	g.visited[ptr] = struct{}{}
+	return true
+}
+
 // Finder is used to set a Finder for a type.
 func (h *Hydrator) Finder(obj interface{}, finder Finder) {
 	objType := reflect.Indirect(reflect.ValueOf(obj)).Type()
@@ -65,15 +213,110 @@ func (h *Hydrator) Finder(obj interface{}, finder Finder) {
 	h.Unlock()
 }
 
+// BatchFinder is used to set a BatchFinder for a type. When set, field
+// lookups that would otherwise call the per-instance Finder for the type are
+// instead coalesced by a per-Hydrate-call loader, which invokes finder once
+// per batch window with the deduped set of IDs requested in that window
+// across the object graph. If no
+// BatchFinder is registered for a type, the per-instance Finder (if any) is
+// used as before.
+func (h *Hydrator) BatchFinder(obj interface{}, finder BatchFinder) {
+	objType := reflect.Indirect(reflect.ValueOf(obj)).Type()
+	h.Lock()
+	h.batchFinders[objType.PkgPath()+objType.Name()] = finder
+	h.Unlock()
+}
+
+// LookupFinder returns the per-instance Finder registered for key (a type's
+// PkgPath()+Name()), if any. It is exported for generated HydrateWith
+// methods (see cmd/hydrategen), which still need to go through the runtime
+// registry since finders are registered dynamically, even though the call
+// site itself is no longer reflective.
+func (h *Hydrator) LookupFinder(key string) (Finder, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	finder, ok := h.finders[key]
+	return finder, ok
+}
+
+// LookupBatchFinder returns the BatchFinder registered for key, if any. See
+// LookupFinder.
+func (h *Hydrator) LookupBatchFinder(key string) (BatchFinder, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	finder, ok := h.batchFinders[key]
+	return finder, ok
+}
+
 // hydrationResult is the result of a hydration.
 type hydrationResult struct {
-	field string
-	err   error
-	val   interface{}
+	field      string
+	fieldIndex int
+	err        error
+	val        interface{}
+	sel        *selectionNode
+	excl       *selectionNode
+	required   bool
+}
+
+// Hydrate takes on object and attempts to dynamically hydrate it. By
+// default the entire tagged graph reachable from obj is hydrated; pass
+// WithSelection and/or Without to restrict that to a subtree.
+func (h *Hydrator) Hydrate(ctx context.Context, obj interface{}, opts ...HydrateOpt) error {
+	if hw, ok := obj.(Hydratable); ok && len(opts) == 0 {
+		return h.hydrateWithGuard(ctx, obj, hw)
+	}
+
+	cfg := &hydrateConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	l := newLoader(h)
+	if v := reflect.ValueOf(obj); v.Kind() == reflect.Ptr {
+		l.visit(v.Pointer())
+	}
+	return h.hydrate(ctx, obj, l, walkState{sel: cfg.selection, excl: cfg.exclusion})
+}
+
+// hydrateWithGuard calls hw.HydrateWith, first enforcing the same
+// MaxDepth/cycle-detection guarantees the reflective path gets from loader.
+// It creates a *hydratableGuard on the first (top-level) call and stashes it
+// in ctx so every nested h.Hydrate(ctx, child) call inside generated code
+// finds and reuses it instead of starting over.
+func (h *Hydrator) hydrateWithGuard(ctx context.Context, obj interface{}, hw Hydratable) error {
+	guard, _ := ctx.Value(hydratableGuardKey{}).(*hydratableGuard)
+	if guard == nil {
+		guard = &hydratableGuard{visited: map[uintptr]struct{}{}}
+		ctx = context.WithValue(ctx, hydratableGuardKey{}, guard)
+	}
+	depth, _ := ctx.Value(hydratableDepthKey{}).(int)
+
+	typeName := reflect.TypeOf(obj).String()
+	if h.maxDepth > 0 && depth > h.maxDepth {
+		return &MaxDepthError{Path: typeName, Depth: h.maxDepth}
+	}
+
+	if v := reflect.ValueOf(obj); v.Kind() == reflect.Ptr {
+		if !guard.visit(v.Pointer()) {
+			if h.cycleBehavior == CycleError {
+				return &CycleDetectedError{Path: typeName}
+			}
+			return nil
+		}
+	}
+
+	return hw.HydrateWith(context.WithValue(ctx, hydratableDepthKey{}, depth+1), h)
 }
 
-// Hydrate takes on object and attempts to dynamically hydrate it.
-func (h *Hydrator) Hydrate(obj interface{}) error {
+// hydrate is the internal recursive implementation of Hydrate. It takes a
+// loader shared across the entire object graph walked by a single top-level
+// Hydrate call so that finder requests for the same type can be coalesced
+// and cycles detected regardless of how deep in the graph they are raised.
+// ws tracks how deep the walk is, the dotted field path to obj, and the
+// selection/exclusion scopes in effect, for MaxDepth/CycleDetectedError messages and
+// WithSelection/Without filtering.
+func (h *Hydrator) hydrate(ctx context.Context, obj interface{}, l *loader, ws walkState) error {
 	var err error
 
 	objVal := reflect.ValueOf(obj)
@@ -84,101 +327,200 @@ func (h *Hydrator) Hydrate(obj interface{}) error {
 		return ErrInvalidObject
 	}
 
+	fields := cachedFields(objType, h.tag)
+
 	var wg sync.WaitGroup
-	// make the result channel number of fields + 1 just to be safe
-	resChan := make(chan hydrationResult, indObjVal.NumField()+1)
+	var resMu sync.Mutex
+	resultsPtr := getResults()
+	defer putResults(resultsPtr)
 
-	for i := 0; i < indObjVal.NumField(); i++ {
-		structField := indObjVal.Type().Field(i)
-		kind := structField.Type.Kind()
+	for _, cf := range fields {
+		selMatched, childSel := ws.sel.match(cf.name)
+		if !selMatched {
+			continue
+		}
+
+		var childExcl *selectionNode
+		if ws.excl != nil {
+			if exclMatched, exclChild := ws.excl.match(cf.name); exclMatched {
+				if exclChild == nil {
+					// Without named this field exactly: skip it entirely.
+					continue
+				}
+				childExcl = exclChild
+			}
+		}
 
-		hydrateTag := structField.Tag.Get(h.tag)
-		if hydrateTag == "" || hydrateTag == "-" {
-			// if there is no struct tag
+		if cf.omitempty && !indObjVal.Field(cf.index).IsZero() {
+			// already populated (e.g. a cache hit upstream); leave it alone.
 			continue
 		}
 
-		if structField.Anonymous || !indObjVal.CanSet() {
+		if cf.anonymous || !indObjVal.CanSet() {
 			err = fmt.Errorf(
 				"Attempted to hydrate anonymous field %s",
-				structField.Name,
+				cf.name,
 			)
 			break
 		}
 
 		// only hydrate pointers, slices, and arrays
-		if kind != reflect.Ptr && (kind != reflect.Slice && kind != reflect.Array) {
+		if !cf.isPointer && !cf.isSlice && !cf.isArray {
 			err = fmt.Errorf(
 				"Attempted to hydrate %v field %s",
-				kind,
-				structField.Name,
+				cf.kind,
+				cf.name,
 			)
 			break
 		}
 
 		// if there is a method on the struct try calling it
-		_, ok := objType.MethodByName(hydrateTag)
-		if ok {
+		if cf.methodIndex >= 0 {
 			wg.Add(1)
-			go func(flowChan chan struct{}) {
+			go func(flowChan chan struct{}, cf cachedField) {
 				defer wg.Done()
 				flowChan <- struct{}{}
-				vals := objVal.MethodByName(hydrateTag).Call(
-					[]reflect.Value{
-						objVal,
-					},
-				)
 
-				var err error
-				if vals[1].Interface() != nil {
-					err = vals[1].Interface().(error)
+				method := objVal.Method(cf.methodIndex)
+				var res hydrationResult
+				res.field = cf.name
+				res.fieldIndex = cf.index
+				res.sel = childSel
+				res.excl = childExcl
+				res.required = cf.required
+
+				if mt := method.Type(); mt.NumIn() != 2 || mt.NumOut() != 2 {
+					res.err = fmt.Errorf(
+						"method %s on field %s does not implement the resolver signature func(context.Context, interface{}) (interface{}, error)",
+						cf.tagValue,
+						cf.name,
+					)
+				} else {
+					vals := method.Call([]reflect.Value{
+						reflect.ValueOf(ctx),
+						objVal,
+					})
+					if vals[1].Interface() != nil {
+						res.err = vals[1].Interface().(error)
+					}
+					res.val = vals[0].Interface()
 				}
 
-				resChan <- hydrationResult{
-					err:   err,
-					val:   vals[0].Interface(),
-					field: structField.Name,
-				}
+				resMu.Lock()
+				*resultsPtr = append(*resultsPtr, res)
+				resMu.Unlock()
 				<-flowChan
-			}(h.flowChan)
+			}(h.flowChan, cf)
 			continue
 		}
 
 		h.RLock()
-		finder, ok := h.finders[structField.Type.Elem().PkgPath()+structField.Type.Elem().Name()]
+		batchFinder, hasBatch := h.batchFinders[cf.finderKey]
+		finder, hasFinder := h.finders[cf.finderKey]
 		h.RUnlock()
 
 		// if there is no finder then continue
-		if !ok {
+		if !hasBatch && !hasFinder {
+			continue
+		}
+
+		// the tag names a sibling field holding the ID(s) to look up, not
+		// the tagged field itself
+		idField := indObjVal.FieldByName(cf.tagValue)
+		if cf.idFieldIndex >= 0 {
+			idField = indObjVal.Field(cf.idFieldIndex)
+		}
+
+		if cf.dive && (cf.isSlice || cf.isArray) {
+			wg.Add(1)
+			go func(flowChan chan struct{}, cf cachedField, idsVal reflect.Value, targetType reflect.Type) {
+				defer wg.Done()
+				flowChan <- struct{}{}
+
+				n := idsVal.Len()
+				vals := make([]interface{}, n)
+				errs := make([]error, n)
+
+				var dwg sync.WaitGroup
+				for i := 0; i < n; i++ {
+					dwg.Add(1)
+					go func(i int) {
+						defer dwg.Done()
+						id := idsVal.Index(i).Interface()
+						if hasBatch {
+							vals[i], errs[i] = l.request(ctx, cf.finderKey, id, batchFinder)
+						} else {
+							vals[i], errs[i] = finder(ctx, id)
+						}
+					}(i)
+				}
+				dwg.Wait()
+
+				var err error
+				sliceVal := reflect.MakeSlice(targetType, n, n)
+				for i, v := range vals {
+					if errs[i] != nil && err == nil {
+						err = errs[i]
+						continue
+					}
+					if v != nil {
+						sliceVal.Index(i).Set(reflect.ValueOf(v))
+					}
+				}
+
+				resMu.Lock()
+				*resultsPtr = append(*resultsPtr, hydrationResult{
+					err:        err,
+					val:        sliceVal.Interface(),
+					field:      cf.name,
+					fieldIndex: cf.index,
+					sel:        childSel,
+					excl:       childExcl,
+					required:   cf.required,
+				})
+				resMu.Unlock()
+				<-flowChan
+			}(h.flowChan, cf, idField, indObjVal.Field(cf.index).Type())
 			continue
 		}
 
 		wg.Add(1)
-		go func(flowChan chan struct{}, finder Finder) {
+		go func(flowChan chan struct{}, cf cachedField, id interface{}) {
 			defer wg.Done()
 			flowChan <- struct{}{}
-			val, err := finder(indObjVal.FieldByName(hydrateTag).Interface())
-			resChan <- hydrationResult{
-				err:   err,
-				val:   val,
-				field: structField.Name,
+
+			var val interface{}
+			var err error
+			if hasBatch {
+				val, err = l.request(ctx, cf.finderKey, id, batchFinder)
+			} else {
+				val, err = finder(ctx, id)
 			}
+
+			resMu.Lock()
+			*resultsPtr = append(*resultsPtr, hydrationResult{
+				err:        err,
+				val:        val,
+				field:      cf.name,
+				fieldIndex: cf.index,
+				sel:        childSel,
+				excl:       childExcl,
+				required:   cf.required,
+			})
+			resMu.Unlock()
 			<-flowChan
-		}(h.flowChan, finder)
+		}(h.flowChan, cf, idField.Interface())
 	}
 
-	go func() {
-		wg.Wait()
-		close(resChan)
-	}()
+	wg.Wait()
 
-	for res := range resChan {
+	for _, res := range *resultsPtr {
 		if res.err != nil {
 			err = res.err
 			continue
 		}
 
-		field := indObjVal.FieldByName(res.field)
+		field := indObjVal.Field(res.fieldIndex)
 		if !field.CanSet() {
 			err = fmt.Errorf(
 				"Attempted to hydrate a private field on %T",
@@ -188,13 +530,30 @@ func (h *Hydrator) Hydrate(obj interface{}) error {
 		}
 
 		resVal := reflect.ValueOf(res.val)
+		fieldPath := joinPath(ws.path, res.field)
+
+		if res.required && isEmptyResult(resVal) {
+			err = fmt.Errorf("hydrator: required field %s was not hydrated", fieldPath)
+			continue
+		}
+
 		resType := resVal.Type()
 
 		// recursive hydration if it is a struct
 		if resType.Kind() == reflect.Ptr && resVal.Elem().Type().Kind() == reflect.Struct {
-			if er := h.Hydrate(res.val); er != nil {
-				err = er
-				continue
+			switch {
+			case h.maxDepth > 0 && ws.depth+1 > h.maxDepth:
+				err = &MaxDepthError{Path: fieldPath, Depth: h.maxDepth}
+			case !l.visit(resVal.Pointer()):
+				if h.cycleBehavior == CycleError {
+					err = &CycleDetectedError{Path: fieldPath}
+				}
+			default:
+				childWS := walkState{depth: ws.depth + 1, path: fieldPath, sel: res.sel, excl: res.excl}
+				if er := h.hydrate(ctx, res.val, l, childWS); er != nil {
+					err = er
+					continue
+				}
 			}
 		}
 
@@ -206,7 +565,8 @@ func (h *Hydrator) Hydrate(obj interface{}) error {
 
 			// hydrate slices concurrently
 			var swg sync.WaitGroup
-			sliceResChan := make(chan hydrationResult, resVal.Len())
+			var errMu sync.Mutex
+			errsPtr := getErrs()
 
 			for i := 0; i < resVal.Len(); i++ {
 				swg.Add(1)
@@ -214,26 +574,36 @@ func (h *Hydrator) Hydrate(obj interface{}) error {
 					defer swg.Done()
 					flowChan <- struct{}{}
 
-					err := h.Hydrate(resVal.Index(i).Interface())
+					elem := resVal.Index(i)
+					elemPath := fmt.Sprintf("%s[%d]", fieldPath, i)
+
+					var err error
+					switch {
+					case h.maxDepth > 0 && ws.depth+1 > h.maxDepth:
+						err = &MaxDepthError{Path: elemPath, Depth: h.maxDepth}
+					case elem.Kind() == reflect.Ptr && !l.visit(elem.Pointer()):
+						if h.cycleBehavior == CycleError {
+							err = &CycleDetectedError{Path: elemPath}
+						}
+					default:
+						childWS := walkState{depth: ws.depth + 1, path: elemPath, sel: res.sel, excl: res.excl}
+						err = h.hydrate(ctx, elem.Interface(), l, childWS)
+					}
 
-					sliceResChan <- hydrationResult{
-						err: err,
+					if err != nil {
+						errMu.Lock()
+						*errsPtr = append(*errsPtr, err)
+						errMu.Unlock()
 					}
 					<-flowChan
 
 				}(h.flowChan, i)
 			}
-			go func() {
-				swg.Wait()
-				close(sliceResChan)
-			}()
-			for sliceRes := range sliceResChan {
-				if sliceRes.err != nil {
-					err = sliceRes.err
-					continue
-				}
+			swg.Wait()
+			for _, sliceErr := range *errsPtr {
+				err = sliceErr
 			}
-
+			putErrs(errsPtr)
 		}
 
 		// check if the caller was lazy and messed up returning
@@ -253,3 +623,25 @@ func (h *Hydrator) Hydrate(obj interface{}) error {
 
 	return err
 }
+
+// joinPath appends field to the dotted field path base, used for MaxDepth
+// and CycleDetectedError messages.
+func joinPath(base, field string) string {
+	if base == "" {
+		return field
+	}
+	return base + "." + field
+}
+
+// isEmptyResult reports whether a resolver's return value should be treated
+// as "nothing found" for a required field.
+func isEmptyResult(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
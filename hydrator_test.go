@@ -3,6 +3,7 @@ package hydrator
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -455,3 +456,504 @@ func Test_Hydrator_non_finder_method(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// BatchChild is a struct used to test BatchFinder coalescing.
+type BatchChild struct {
+	ID int
+}
+
+// BatchMiddle is a struct whose Child is resolved via a Finder/BatchFinder
+// keyed on ChildID.
+type BatchMiddle struct {
+	ID      int
+	ChildID int
+	Child   *BatchChild `hydrate:"ChildID"`
+}
+
+// BatchRoot is a struct used to test that hydrating a slice of siblings that
+// reference the same type only calls the registered BatchFinder once.
+type BatchRoot struct {
+	ID      int
+	Middles []*BatchMiddle `hydrate:"GetMiddles"`
+}
+
+// GetMiddles returns a handful of BatchMiddle, some of which share a
+// ChildID, to exercise deduping.
+func (r *BatchRoot) GetMiddles(
+	ctx context.Context,
+	x interface{},
+) (interface{}, error) {
+	return []*BatchMiddle{
+		{ID: 1, ChildID: 10},
+		{ID: 2, ChildID: 20},
+		{ID: 3, ChildID: 10},
+	}, nil
+}
+
+func Test_Hydrator_BatchFinder(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	var mu sync.Mutex
+	var calls [][]interface{}
+
+	h.BatchFinder(
+		BatchChild{},
+		func(ctx context.Context, ids []interface{}) ([]interface{}, error) {
+			mu.Lock()
+			calls = append(calls, ids)
+			mu.Unlock()
+
+			res := make([]interface{}, len(ids))
+			for i, id := range ids {
+				res[i] = &BatchChild{ID: id.(int)}
+			}
+			return res, nil
+		},
+	)
+
+	r := &BatchRoot{ID: 1}
+
+	if err := h.Hydrate(ctx, r); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if len(r.Middles) != 3 {
+		t.Errorf("expected 3 middles, got %d", len(r.Middles))
+		t.FailNow()
+	}
+	for _, m := range r.Middles {
+		if m.Child == nil || m.Child.ID != m.ChildID {
+			t.Errorf("expected Child %d, got %+v", m.ChildID, m.Child)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 {
+		t.Errorf(
+			"expected BatchFinder to be invoked once, got %d calls: %v",
+			len(calls),
+			calls,
+		)
+		t.FailNow()
+	}
+	if len(calls[0]) != 2 {
+		t.Errorf("expected 2 deduped ids, got %d: %v", len(calls[0]), calls[0])
+	}
+}
+
+// Node is a self-referential struct, shaped after the Yaegi issue-1304
+// report, used to test that back-references don't cause unbounded
+// recursion.
+type Node struct {
+	ID    int
+	Alias *Node   `hydrate:"GetAlias"`
+	Child []*Node `hydrate:"GetChild"`
+}
+
+func (n *Node) GetAlias(ctx context.Context, x interface{}) (interface{}, error) {
+	return n, nil
+}
+
+func (n *Node) GetChild(ctx context.Context, x interface{}) (interface{}, error) {
+	if n.ID != 1 {
+		return []*Node{}, nil
+	}
+	return []*Node{n}, nil
+}
+
+func Test_Hydrator_cycle_skip(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	n := &Node{ID: 1}
+
+	if err := h.Hydrate(ctx, n); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if n.Alias != n {
+		t.Errorf("expected Alias to be set to the same Node")
+	}
+	if len(n.Child) != 1 || n.Child[0] != n {
+		t.Errorf("expected Child to contain the same Node")
+	}
+}
+
+func Test_Hydrator_cycle_error(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator(OnCycle(CycleError))
+
+	n := &Node{ID: 1}
+
+	if err := h.Hydrate(ctx, n); err == nil {
+		t.Errorf("expected a cycle error")
+		t.FailNow()
+	} else if _, ok := err.(*CycleDetectedError); !ok {
+		t.Errorf("expected a *CycleDetectedError, got %T: %v", err, err)
+	}
+}
+
+func Test_Hydrator_max_depth(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator(MaxDepth(1))
+
+	a := &A{ID: 1}
+
+	if err := h.Hydrate(ctx, a); err == nil {
+		t.Errorf("expected a max depth error")
+		t.FailNow()
+	} else if _, ok := err.(*MaxDepthError); !ok {
+		t.Errorf("expected a *MaxDepthError, got %T: %v", err, err)
+	}
+}
+
+// SharedGrand is used by Test_Hydrator_cached_pointer to count how many
+// times its Finder is invoked.
+type SharedGrand struct {
+	ID int
+}
+
+// SharedChild is resolved via a Finder that returns the same cached
+// instance for every ID, to test that recursing into a cached pointer
+// twice doesn't re-run its own hydration twice.
+type SharedChild struct {
+	ID      int
+	GrandID int
+	Grand   *SharedGrand `hydrate:"GrandID"`
+}
+
+// SharedParent has two fields that resolve to the same cached SharedChild
+// instance.
+type SharedParent struct {
+	ID      int
+	LeftID  int
+	RightID int
+	Left    *SharedChild `hydrate:"LeftID"`
+	Right   *SharedChild `hydrate:"RightID"`
+}
+
+func Test_Hydrator_cached_pointer(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	cached := &SharedChild{ID: 1}
+
+	var mu sync.Mutex
+	grandCalls := 0
+
+	h.Finder(
+		SharedChild{},
+		func(ctx context.Context, id interface{}) (interface{}, error) {
+			return cached, nil
+		},
+	)
+	h.Finder(
+		SharedGrand{},
+		func(ctx context.Context, id interface{}) (interface{}, error) {
+			mu.Lock()
+			grandCalls++
+			mu.Unlock()
+			return &SharedGrand{ID: 1}, nil
+		},
+	)
+
+	p := &SharedParent{ID: 1, LeftID: 1, RightID: 1}
+	if err := h.Hydrate(ctx, p); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if p.Left != p.Right {
+		t.Errorf("expected Left and Right to share the cached pointer")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if grandCalls != 1 {
+		t.Errorf(
+			"expected the cached pointer to only be recursed into once, got %d calls",
+			grandCalls,
+		)
+	}
+}
+
+func Test_Hydrator_WithSelection(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	a := &A{ID: 1}
+	if err := h.Hydrate(ctx, a, WithSelection("C", "C.D")); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if a.C == nil {
+		t.Errorf("expected A.C to be selected")
+		t.FailNow()
+	}
+	if a.C.D == nil {
+		t.Errorf("expected A.C.D to be selected")
+	}
+	if a.C.DD != nil {
+		t.Errorf("expected A.C.DD to be unselected, got %+v", a.C.DD)
+	}
+	if a.NP != nil {
+		t.Errorf("expected A.NP to be unselected, got %+v", a.NP)
+	}
+}
+
+func Test_Hydrator_WithSelection_wildcard(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	a := &A{ID: 1}
+	if err := h.Hydrate(ctx, a, WithSelection("C.*")); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if a.C == nil {
+		t.Errorf("expected A.C to be selected")
+		t.FailNow()
+	}
+	if a.C.D == nil {
+		t.Errorf("expected A.C.D to be selected via C.*")
+	}
+	if len(a.C.DD) != 1 {
+		t.Errorf("expected A.C.DD to be selected via C.*")
+	}
+	if a.NP != nil {
+		t.Errorf("expected A.NP to be unselected, got %+v", a.NP)
+	}
+}
+
+func Test_Hydrator_Without(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	a := &A{ID: 1}
+	if err := h.Hydrate(ctx, a, Without("C.D")); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if a.C == nil {
+		t.Errorf("expected A.C to still be hydrated")
+		t.FailNow()
+	}
+	if a.C.D != nil {
+		t.Errorf("expected A.C.D to be excluded, got %+v", a.C.D)
+	}
+	if len(a.C.DD) != 1 {
+		t.Errorf("expected A.C.DD to still be hydrated")
+	}
+	if a.NP == nil {
+		t.Errorf("expected A.NP to still be hydrated")
+	}
+}
+
+// OmitEmptyParent is used to test the omitempty tag option.
+type OmitEmptyParent struct {
+	ID int
+	C  *C `hydrate:"GetC,omitempty"`
+}
+
+func (o *OmitEmptyParent) GetC(ctx context.Context, x interface{}) (interface{}, error) {
+	return &C{ID: 100}, nil
+}
+
+func Test_Hydrator_OmitEmpty(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	already := &OmitEmptyParent{ID: 1, C: &C{ID: 1}}
+	if err := h.Hydrate(ctx, already); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if already.C.ID != 1 {
+		t.Errorf("expected omitempty to leave a pre-populated field alone, got ID %d", already.C.ID)
+	}
+
+	empty := &OmitEmptyParent{ID: 2}
+	if err := h.Hydrate(ctx, empty); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if empty.C == nil || empty.C.ID != 100 {
+		t.Errorf("expected omitempty to still hydrate a zero-valued field")
+	}
+}
+
+// RequiredParent is used to test the required tag option.
+type RequiredParent struct {
+	ID int
+	C  *C `hydrate:"GetNil,required"`
+}
+
+func (r *RequiredParent) GetNil(ctx context.Context, x interface{}) (interface{}, error) {
+	return (*C)(nil), nil
+}
+
+func Test_Hydrator_Required(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	r := &RequiredParent{ID: 1}
+	err := h.Hydrate(ctx, r)
+	if err == nil {
+		t.Errorf("expected a required-field error, got nil")
+		t.FailNow()
+	}
+	if err.Error() != "hydrator: required field C was not hydrated" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// RequiredSliceParent combines required with a method that returns a slice,
+// mirroring the "GetDD,dive,required" tag from the request: dive has no
+// effect on a method-backed field (the method already builds the whole
+// slice), but required still applies to its result.
+type RequiredSliceParent struct {
+	ID int
+	DD []*D `hydrate:"GetDD,dive,required"`
+}
+
+func (r *RequiredSliceParent) GetDD(ctx context.Context, x interface{}) (interface{}, error) {
+	return []*D(nil), nil
+}
+
+func Test_Hydrator_RequiredSlice(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	r := &RequiredSliceParent{ID: 1}
+	err := h.Hydrate(ctx, r)
+	if err == nil {
+		t.Errorf("expected a required-field error, got nil")
+		t.FailNow()
+	}
+	if err.Error() != "hydrator: required field DD was not hydrated" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// DiveChild is used to test the dive tag option.
+type DiveChild struct {
+	ID int
+}
+
+// DiveParent's Children field dives over ChildIDs, calling the DiveChild
+// Finder once per ID instead of once for the whole slice.
+type DiveParent struct {
+	ID       int
+	ChildIDs []int
+	Children []*DiveChild `hydrate:"ChildIDs,dive"`
+}
+
+func Test_Hydrator_Dive(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+	h.Finder(
+		DiveChild{},
+		func(ctx context.Context, id interface{}) (interface{}, error) {
+			return &DiveChild{ID: id.(int)}, nil
+		},
+	)
+
+	p := &DiveParent{ID: 1, ChildIDs: []int{10, 20, 30}}
+	if err := h.Hydrate(ctx, p); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if len(p.Children) != len(p.ChildIDs) {
+		t.Fatalf("expected %d children, got %d", len(p.ChildIDs), len(p.Children))
+	}
+	for i, id := range p.ChildIDs {
+		if p.Children[i] == nil || p.Children[i].ID != id {
+			t.Errorf("expected Children[%d].ID to be %d, got %+v", i, id, p.Children[i])
+		}
+	}
+}
+
+// GeneratedParent hand-writes the HydrateWith method hydrategen would
+// produce, to test that Hydrate prefers it over the reflective path.
+type GeneratedParent struct {
+	ID      int
+	C       *C
+	viaCall bool
+}
+
+func (g *GeneratedParent) HydrateWith(ctx context.Context, h *Hydrator) error {
+	g.viaCall = true
+	g.C = &C{ID: 42}
+	return nil
+}
+
+func Test_Hydrator_PrefersHydratable(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	g := &GeneratedParent{ID: 1}
+	if err := h.Hydrate(ctx, g); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if !g.viaCall {
+		t.Errorf("expected Hydrate to call the type's HydrateWith method")
+	}
+	if g.C == nil || g.C.ID != 42 {
+		t.Errorf("expected HydrateWith's result to have been used, got %+v", g.C)
+	}
+}
+
+func Test_Hydrator_PrefersHydratable_FallsBackWithSelectionOpts(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+
+	g := &GeneratedParent{ID: 1}
+	// GeneratedParent has no hydrate tags, so with selection opts (which
+	// force the reflective path) Hydrate should simply find nothing to do
+	// rather than calling HydrateWith.
+	if err := h.Hydrate(ctx, g, WithSelection("C")); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if g.viaCall {
+		t.Errorf("expected HydrateOpt args to force the reflective path, not HydrateWith")
+	}
+}
+
+func Test_Hydrator_Dive_BatchFinder(t *testing.T) {
+	ctx := context.Background()
+	h := NewHydrator()
+	var batchCalls int
+	h.BatchFinder(
+		DiveChild{},
+		func(ctx context.Context, ids []interface{}) ([]interface{}, error) {
+			batchCalls++
+			res := make([]interface{}, len(ids))
+			for i, id := range ids {
+				res[i] = &DiveChild{ID: id.(int)}
+			}
+			return res, nil
+		},
+	)
+
+	p := &DiveParent{ID: 1, ChildIDs: []int{1, 2, 3}}
+	if err := h.Hydrate(ctx, p); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if len(p.Children) != 3 {
+		t.Fatalf("expected 3 children, got %d", len(p.Children))
+	}
+	if batchCalls != 1 {
+		t.Errorf("expected diving IDs to coalesce into a single batch call, got %d", batchCalls)
+	}
+}
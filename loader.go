@@ -0,0 +1,156 @@
+package hydrator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// loader coalesces per-type Finder requests raised while walking a single
+// Hydrate call's object graph into batched BatchFinder calls, similar to the
+// dataloader pattern used by GraphQL resolvers. A loader is created for
+// every top-level Hydrate call and shared with all of its recursive
+// descendants so that a wide, repetitive graph (e.g. a slice of siblings
+// that all reference the same type) results in one call per type instead of
+// one call per field.
+type loader struct {
+	h *Hydrator
+
+	mu     sync.Mutex
+	groups map[string]*batchGroup
+
+	visitedMu sync.Mutex
+	visited   map[uintptr]struct{}
+}
+
+// batchGroup accumulates the requests for a single type key within a
+// loader's batch window.
+type batchGroup struct {
+	mu      sync.Mutex
+	ids     []interface{}
+	seen    map[interface{}]struct{}
+	waiters []batchWaiter
+	timer   *time.Timer
+	fired   bool
+}
+
+type batchWaiter struct {
+	id interface{}
+	ch chan loaderResult
+}
+
+type loaderResult struct {
+	val interface{}
+	err error
+}
+
+func newLoader(h *Hydrator) *loader {
+	return &loader{
+		h:       h,
+		groups:  map[string]*batchGroup{},
+		visited: map[uintptr]struct{}{},
+	}
+}
+
+// visit records ptr as visited for the lifetime of this loader (i.e. a
+// single top-level Hydrate call). It reports whether ptr was newly recorded;
+// false means it had already been visited, signalling a cycle.
+func (l *loader) visit(ptr uintptr) bool {
+	l.visitedMu.Lock()
+	defer l.visitedMu.Unlock()
+	if _, ok := l.visited[ptr]; ok {
+		return false
+	}
+	l.visited[ptr] = struct{}{}
+	return true
+}
+
+// request enqueues an id lookup for the given type key and blocks until the
+// batch for that key fires and results are dispatched. A type key's
+// batchGroup only lives for one wave: once it fires, request starts a fresh
+// group for any later call with the same key instead of joining the spent
+// one, which would never dispatch to it.
+func (l *loader) request(
+	ctx context.Context,
+	key string,
+	id interface{},
+	finder BatchFinder,
+) (interface{}, error) {
+	for {
+		l.mu.Lock()
+		bg, ok := l.groups[key]
+		if !ok {
+			bg = &batchGroup{seen: map[interface{}]struct{}{}}
+			l.groups[key] = bg
+		}
+		l.mu.Unlock()
+
+		ch := make(chan loaderResult, 1)
+
+		bg.mu.Lock()
+		if bg.fired {
+			bg.mu.Unlock()
+			l.mu.Lock()
+			if l.groups[key] == bg {
+				delete(l.groups, key)
+			}
+			l.mu.Unlock()
+			continue
+		}
+		if _, dup := bg.seen[id]; !dup {
+			bg.seen[id] = struct{}{}
+			bg.ids = append(bg.ids, id)
+		}
+		bg.waiters = append(bg.waiters, batchWaiter{id: id, ch: ch})
+		if bg.timer == nil {
+			bg.timer = time.AfterFunc(l.h.batchWindow, func() {
+				l.flush(ctx, key, bg, finder)
+			})
+		} else {
+			bg.timer.Reset(l.h.batchWindow)
+		}
+		bg.mu.Unlock()
+
+		res := <-ch
+		return res.val, res.err
+	}
+}
+
+// flush invokes the BatchFinder for key once with the deduped IDs collected
+// so far and dispatches results (or the error) to every waiter.
+func (l *loader) flush(ctx context.Context, key string, bg *batchGroup, finder BatchFinder) {
+	bg.mu.Lock()
+	if bg.fired {
+		bg.mu.Unlock()
+		return
+	}
+	bg.fired = true
+	ids := bg.ids
+	waiters := bg.waiters
+	bg.mu.Unlock()
+
+	l.mu.Lock()
+	if l.groups[key] == bg {
+		delete(l.groups, key)
+	}
+	l.mu.Unlock()
+
+	vals, err := finder(ctx, ids)
+	if err != nil {
+		for _, w := range waiters {
+			w.ch <- loaderResult{err: err}
+		}
+		return
+	}
+
+	byID := make(map[interface{}]interface{}, len(ids))
+	for i, id := range ids {
+		if i < len(vals) {
+			byID[id] = vals[i]
+		}
+	}
+
+	for _, w := range waiters {
+		w.ch <- loaderResult{val: byID[w.id]}
+	}
+}
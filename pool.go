@@ -0,0 +1,40 @@
+package hydrator
+
+import "sync"
+
+// resultPool recycles the hydrationResult slices used to collect a single
+// hydrate call's field results, so deeply recursive hydration doesn't
+// allocate a fresh slice for every struct visited.
+var resultPool = sync.Pool{
+	New: func() interface{} {
+		s := make([]hydrationResult, 0, 8)
+		return &s
+	},
+}
+
+func getResults() *[]hydrationResult {
+	return resultPool.Get().(*[]hydrationResult)
+}
+
+func putResults(s *[]hydrationResult) {
+	*s = (*s)[:0]
+	resultPool.Put(s)
+}
+
+// errPool recycles the error slices used to collect errors from hydrating a
+// slice or array field's elements concurrently.
+var errPool = sync.Pool{
+	New: func() interface{} {
+		s := make([]error, 0, 8)
+		return &s
+	},
+}
+
+func getErrs() *[]error {
+	return errPool.Get().(*[]error)
+}
+
+func putErrs(s *[]error) {
+	*s = (*s)[:0]
+	errPool.Put(s)
+}
@@ -0,0 +1,98 @@
+package hydrator
+
+import "strings"
+
+// HydrateOpt configures a single call to Hydrate, as opposed to Opt which
+// configures the Hydrator itself.
+type HydrateOpt func(*hydrateConfig)
+
+// hydrateConfig holds the per-call options built up from a Hydrate call's
+// HydrateOpt arguments.
+type hydrateConfig struct {
+	selection *selectionNode
+	exclusion *selectionNode
+}
+
+// WithSelection restricts a Hydrate call to only the given dotted field
+// paths (and their descendants), e.g. WithSelection("C", "C.D", "C.DD")
+// hydrates A.C, and within C only D and DD, skipping any other tagged
+// fields on A or C. A trailing "*" segment matches every tagged field at
+// that level, e.g. "C.*" selects all of C's tagged fields. This is the
+// eager-load/preload pattern from SQL ORMs applied to Hydrate.
+func WithSelection(paths ...string) HydrateOpt {
+	return func(c *hydrateConfig) {
+		c.selection = newSelectionTrie(paths)
+	}
+}
+
+// Without excludes the given dotted field paths (and their descendants)
+// from an otherwise full hydration, e.g. Without("C.D") hydrates
+// everything except A.C.D. It is the inverse of WithSelection.
+func Without(paths ...string) HydrateOpt {
+	return func(c *hydrateConfig) {
+		c.exclusion = newSelectionTrie(paths)
+	}
+}
+
+// selectionNode is a trie node over dotted field-path segments. A nil
+// *selectionNode always matches everything with no further restriction,
+// which is what makes the zero value (no WithSelection/Without given)
+// behave like today's full hydration.
+type selectionNode struct {
+	children map[string]*selectionNode
+	wildcard bool
+}
+
+// newSelectionTrie builds a trie from a set of dotted field paths, e.g.
+// ["C", "C.D", "C.DD"].
+func newSelectionTrie(paths []string) *selectionNode {
+	root := &selectionNode{children: map[string]*selectionNode{}}
+	for _, p := range paths {
+		node := root
+		for _, seg := range strings.Split(p, ".") {
+			if seg == "*" {
+				node.wildcard = true
+				continue
+			}
+			child, ok := node.children[seg]
+			if !ok {
+				child = &selectionNode{children: map[string]*selectionNode{}}
+				node.children[seg] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// match reports whether name is selected at this level of the trie, and the
+// subtrie to use when recursing into that field's own children. A nil child
+// means name matched with no further restriction below it (because the trie
+// is nil, because the path naming it ended exactly here, or because it
+// matched this level's wildcard).
+func (n *selectionNode) match(name string) (matched bool, child *selectionNode) {
+	if n == nil {
+		return true, nil
+	}
+	if c, ok := n.children[name]; ok {
+		if len(c.children) == 0 && !c.wildcard {
+			return true, nil
+		}
+		return true, c
+	}
+	if n.wildcard {
+		return true, nil
+	}
+	return false, nil
+}
+
+// walkState carries the per-Hydrate-call state threaded through recursive
+// hydrate calls: how deep the walk is, the dotted field path to the current
+// object (for MaxDepth/CycleError messages), and the selection/exclusion
+// scopes in effect at this level.
+type walkState struct {
+	depth int
+	path  string
+	sel   *selectionNode
+	excl  *selectionNode
+}